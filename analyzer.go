@@ -0,0 +1,419 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/zipfs"
+)
+
+// ResultSink получает каждый найденный проблемный диалог и решает, что с ним делать
+// (скопировать папку, проиндексировать в OpenSearch, отправить на вебхук и т.д.).
+type ResultSink interface {
+	Handle(dialog *ProblematicDialog) error
+}
+
+// Analyzer инкапсулирует конфигурацию и состояние одного прогона анализа:
+// куда смотреть, куда писать результаты и через какие синки их раздавать.
+// Раньше вся эта логика жила прямо в main(), что не позволяло ни переиспользовать
+// её в демоне, ни гонять в тестах с разными путями.
+// FS абстрагирует файловую систему (afero.Fs), так что анализатор может
+// читать диалоги с диска, из zip-архива или из дерева в памяти, не меняя
+// ни строчки логики анализа - см. NewOSAnalyzer/NewZipAnalyzer/NewMemAnalyzer.
+type Analyzer struct {
+	FS            afero.Fs // файловая система, с которой читается InputDir
+	OutputFS      afero.Fs // файловая система, на которой пишется OutputBaseDir (обычно = FS)
+	InputDir      string
+	OutputBaseDir string
+	Sinks         []ResultSink
+
+	// Cache, если задан, переиспользует результат analyzeDialogFolder для
+	// папок, которые не изменились с прошлого запуска (см. cache.go). nil -
+	// кэширование отключено, каждая папка анализируется заново.
+	Cache *DialogCache
+}
+
+// NewAnalyzer создаёт анализатор, читающий и пишущий на одной файловой
+// системе, с каталогом-копией результатов в качестве синка по умолчанию.
+func NewAnalyzer(fs afero.Fs, inputDir, outputBaseDir string) *Analyzer {
+	a := &Analyzer{
+		FS:            fs,
+		OutputFS:      fs,
+		InputDir:      inputDir,
+		OutputBaseDir: outputBaseDir,
+	}
+	a.Sinks = append(a.Sinks, NewFolderCopySink(fs, inputDir, outputBaseDir))
+	return a
+}
+
+// NewOSAnalyzer создаёт анализатор поверх реальной файловой системы - это
+// прежнее (и по-прежнему основное) поведение: чтение из inputDir на диске
+// и запись в outputBaseDir на диске.
+func NewOSAnalyzer(inputDir, outputBaseDir string) *Analyzer {
+	return NewAnalyzer(afero.NewOsFs(), inputDir, outputBaseDir)
+}
+
+// NewZipAnalyzer создаёт анализатор, читающий диалоги из zip-архива path -
+// например, выгруженной "мотыльком" папки conversations без распаковки на диск.
+// Архив доступен только на чтение, поэтому результаты (копии папок,
+// trigger_info.txt, INDEX.md) по-прежнему пишутся на реальную файловую
+// систему в outputBaseDir.
+func NewZipAnalyzer(path, outputBaseDir string) (*Analyzer, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("открытие архива %s: %w", path, err)
+	}
+
+	zfs := zipfs.New(&reader.Reader)
+	osfs := afero.NewOsFs()
+
+	a := &Analyzer{
+		FS:            zfs,
+		OutputFS:      osfs,
+		InputDir:      "/",
+		OutputBaseDir: outputBaseDir,
+	}
+	a.Sinks = append(a.Sinks, &FolderCopySink{
+		ReadFS:        zfs,
+		WriteFS:       osfs,
+		InputDir:      "/",
+		OutputBaseDir: outputBaseDir,
+	})
+	return a, nil
+}
+
+// NewMemAnalyzer создаёт анализатор целиком поверх in-memory файловой системы -
+// используется в table-driven тестах, которые засевают MemMapFs синтетическими
+// conv_*_chat.json без касания реального диска.
+func NewMemAnalyzer(inputDir, outputBaseDir string) *Analyzer {
+	return NewAnalyzer(afero.NewMemMapFs(), inputDir, outputBaseDir)
+}
+
+// RunOnce выполняет один полный проход по InputDir: находит проблемные диалоги,
+// раздаёт их по синкам и печатает статистику. Это прежнее тело main().
+func (a *Analyzer) RunOnce() error {
+	if len(currentProblemTypes()) == 0 {
+		initializeProblemTypes()
+	}
+	CleanTriggers()
+	types := currentProblemTypes()
+
+	for typeKey := range types {
+		typeDir := filepath.Join(a.OutputBaseDir, typeKey)
+		if err := a.OutputFS.MkdirAll(typeDir, 0755); err != nil {
+			return fmt.Errorf("создание директории %s: %w", typeDir, err)
+		}
+	}
+
+	folders, err := afero.ReadDir(a.FS, a.InputDir)
+	if err != nil {
+		return fmt.Errorf("чтение директории %s: %w", a.InputDir, err)
+	}
+
+	triggerHash := TriggerSetHash()
+	problematicDialogs := make(chan *ProblematicDialog, 100)
+	var wg sync.WaitGroup
+
+	for _, folder := range folders {
+		if !folder.IsDir() {
+			continue
+		}
+
+		wg.Add(1)
+		go func(folderName string) {
+			defer wg.Done()
+
+			dialogPath := filepath.Join(a.InputDir, folderName)
+
+			if a.Cache != nil {
+				if cached, ok := a.Cache.Lookup(a.FS, dialogPath, triggerHash); ok {
+					if cached != nil {
+						problematicDialogs <- cached
+					}
+					return
+				}
+			}
+
+			dialog := analyzeDialogFolder(a.FS, dialogPath, folderName)
+			if a.Cache != nil {
+				a.Cache.Store(a.FS, dialogPath, triggerHash, dialog)
+			}
+			if dialog != nil {
+				problematicDialogs <- dialog
+			}
+		}(folder.Name())
+	}
+
+	go func() {
+		wg.Wait()
+		close(problematicDialogs)
+	}()
+
+	stats := make(map[string]int)
+	allDialogs := make(map[string][]*ProblematicDialog)
+
+	for dialog := range problematicDialogs {
+		a.dispatch(dialog)
+
+		for _, typeKey := range dialog.Types {
+			stats[typeKey]++
+			allDialogs[typeKey] = append(allDialogs[typeKey], dialog)
+		}
+	}
+
+	printStatistics(stats, allDialogs)
+	createIndexFile(a.OutputFS, a.OutputBaseDir, stats, allDialogs)
+
+	if a.Cache != nil {
+		if err := a.Cache.Save(a.OutputFS); err != nil {
+			fmt.Printf("Ошибка сохранения кэша: %v\n", err)
+		}
+	}
+
+	return nil
+}
+
+// AnalyzeFolder прогоняет один диалог (по имени папки внутри InputDir) через
+// синки анализатора. Используется демоном для инкрементальной обработки
+// вновь появившихся папок, без полного повторного скана InputDir.
+func (a *Analyzer) AnalyzeFolder(folderName string) (*ProblematicDialog, error) {
+	dialogPath := filepath.Join(a.InputDir, folderName)
+
+	var dialog *ProblematicDialog
+	cachedHit := false
+	if a.Cache != nil {
+		if cached, ok := a.Cache.Lookup(a.FS, dialogPath, TriggerSetHash()); ok {
+			dialog = cached
+			cachedHit = true
+		}
+	}
+
+	if !cachedHit {
+		dialog = analyzeDialogFolder(a.FS, dialogPath, folderName)
+		if a.Cache != nil {
+			a.Cache.Store(a.FS, dialogPath, TriggerSetHash(), dialog)
+			if err := a.Cache.Save(a.OutputFS); err != nil {
+				fmt.Printf("Ошибка сохранения кэша: %v\n", err)
+			}
+		}
+	}
+
+	if dialog == nil {
+		return nil, nil
+	}
+	a.dispatch(dialog)
+	return dialog, nil
+}
+
+// dispatch раздаёт найденный диалог по всем сконфигурированным синкам,
+// логируя, но не прерывая обработку при ошибке отдельного синка.
+func (a *Analyzer) dispatch(dialog *ProblematicDialog) {
+	for _, sink := range a.Sinks {
+		if err := sink.Handle(dialog); err != nil {
+			fmt.Printf("Ошибка синка для диалога %s: %v\n", dialog.FolderName, err)
+		}
+	}
+}
+
+// FolderCopySink воспроизводит исходное поведение main(): копирует папку
+// диалога и пишет trigger_info.txt в outputBaseDir/<тип>/<папка>. ReadFS и
+// WriteFS обычно совпадают, но для NewZipAnalyzer различаются: диалоги
+// читаются из архива, а результаты пишутся на реальный диск.
+type FolderCopySink struct {
+	ReadFS        afero.Fs
+	WriteFS       afero.Fs
+	InputDir      string
+	OutputBaseDir string
+}
+
+// NewFolderCopySink создаёт синк, копирующий диалоги по типам в обычные папки
+// той же файловой системы fs.
+func NewFolderCopySink(fs afero.Fs, inputDir, outputBaseDir string) *FolderCopySink {
+	return &FolderCopySink{ReadFS: fs, WriteFS: fs, InputDir: inputDir, OutputBaseDir: outputBaseDir}
+}
+
+func (s *FolderCopySink) Handle(dialog *ProblematicDialog) error {
+	types := currentProblemTypes()
+	for _, typeKey := range dialog.Types {
+		typeDir := filepath.Join(s.OutputBaseDir, typeKey, dialog.FolderName)
+		if err := s.WriteFS.MkdirAll(typeDir, 0755); err != nil {
+			fmt.Printf("Ошибка создания директории для диалога: %v\n", err)
+			continue
+		}
+
+		for _, file := range dialog.Files {
+			srcPath := filepath.Join(s.InputDir, dialog.FolderName, file)
+			dstPath := filepath.Join(typeDir, file)
+
+			input, err := afero.ReadFile(s.ReadFS, srcPath)
+			if err != nil {
+				fmt.Printf("Ошибка чтения файла %s: %v\n", file, err)
+				continue
+			}
+
+			if err := afero.WriteFile(s.WriteFS, dstPath, input, 0644); err != nil {
+				fmt.Printf("Ошибка копирования файла %s: %v\n", file, err)
+			}
+		}
+
+		infoFile := filepath.Join(typeDir, "trigger_info.txt")
+		infoContent := fmt.Sprintf("Диалог: %s\nТип: %s\nПапка: %s\nНайденные триггеры:\n",
+			dialog.ID, types[typeKey].Name, dialog.FolderName)
+		for _, trigger := range dialog.Triggers {
+			kind := "точное"
+			if trigger.Fuzzy {
+				kind = "нечёткое"
+			}
+			infoContent += fmt.Sprintf("- %s (%s, score=%.2f)\n", trigger.Text, kind, trigger.Score)
+		}
+
+		if err := afero.WriteFile(s.WriteFS, infoFile, []byte(infoContent), 0644); err != nil {
+			fmt.Printf("Ошибка создания файла информации: %v\n", err)
+		}
+	}
+
+	return nil
+}
+
+// printStatistics выводит статистику по найденным проблемным диалогам.
+func printStatistics(stats map[string]int, allDialogs map[string][]*ProblematicDialog) {
+	fmt.Println("=== СТАТИСТИКА ПРОБЛЕМНЫХ ДИАЛОГОВ ===")
+	fmt.Println()
+
+	type StatsItem struct {
+		TypeKey string
+		Count   int
+	}
+
+	var statsList []StatsItem
+	for typeKey, count := range stats {
+		statsList = append(statsList, StatsItem{typeKey, count})
+	}
+
+	sort.Slice(statsList, func(i, j int) bool {
+		return statsList[i].Count > statsList[j].Count
+	})
+
+	types := currentProblemTypes()
+	total := 0
+	for _, item := range statsList {
+		typeName := types[item.TypeKey].Name
+		fmt.Printf("%s: %d диалогов\n", typeName, item.Count)
+		total += item.Count
+
+		if dialogs, ok := allDialogs[item.TypeKey]; ok && len(dialogs) > 0 {
+			fmt.Printf("  Примеры диалогов: ")
+			count := 0
+			for _, dialog := range dialogs {
+				if count >= 3 {
+					break
+				}
+				fmt.Printf("%s ", dialog.FolderName)
+				count++
+			}
+			fmt.Println()
+		}
+	}
+
+	fmt.Printf("\nВсего проблемных диалогов: %d\n", total)
+
+	fmt.Println("\n=== НАИБОЛЕЕ ЧАСТЫЕ ТРИГГЕРЫ ===")
+
+	triggerStats := make(map[string]int)
+	for _, dialogs := range allDialogs {
+		for _, dialog := range dialogs {
+			for _, trigger := range dialog.Triggers {
+				triggerStats[trigger.Text]++
+			}
+		}
+	}
+
+	var triggerList []struct {
+		Trigger string
+		Count   int
+	}
+
+	for trigger, count := range triggerStats {
+		triggerList = append(triggerList, struct {
+			Trigger string
+			Count   int
+		}{trigger, count})
+	}
+
+	sort.Slice(triggerList, func(i, j int) bool {
+		return triggerList[i].Count > triggerList[j].Count
+	})
+
+	fmt.Println("Топ-10 самых частых триггеров:")
+	for i := 0; i < 10 && i < len(triggerList); i++ {
+		fmt.Printf("%d. %s (%d раз)\n", i+1, triggerList[i].Trigger, triggerList[i].Count)
+	}
+}
+
+// createIndexFile создаёт индексный файл со всей статистикой на файловой
+// системе fs (диск, zip или in-memory дерево - в зависимости от того, каким
+// конструктором был создан Analyzer).
+func createIndexFile(fs afero.Fs, outputBaseDir string, stats map[string]int, allDialogs map[string][]*ProblematicDialog) {
+	indexPath := filepath.Join(outputBaseDir, "INDEX.md")
+
+	types := currentProblemTypes()
+
+	var content strings.Builder
+	content.WriteString("# Индекс проблемных диалогов\n\n")
+	content.WriteString("## Статистика по типам проблем\n\n")
+
+	total := 0
+	for typeKey, count := range stats {
+		typeName := types[typeKey].Name
+		content.WriteString(fmt.Sprintf("### %s\n", typeName))
+		content.WriteString(fmt.Sprintf("- **Количество диалогов:** %d\n", count))
+		content.WriteString("- **Диалоги:** ")
+
+		if dialogs, ok := allDialogs[typeKey]; ok && len(dialogs) > 0 {
+			for i, dialog := range dialogs {
+				if i > 0 {
+					content.WriteString(", ")
+				}
+				content.WriteString(dialog.FolderName)
+			}
+		}
+		content.WriteString("\n\n")
+
+		total += count
+	}
+
+	content.WriteString(fmt.Sprintf("## Всего проблемных диалогов: %d\n\n", total))
+
+	content.WriteString("## Структура директорий\n\n")
+	content.WriteString("```\n")
+	content.WriteString("problematicDialogs/\n")
+	for typeKey := range types {
+		typeName := types[typeKey].Name
+		content.WriteString(fmt.Sprintf("├── %s/                # %s\n", typeKey, typeName))
+		content.WriteString(fmt.Sprintf("│   ├── AAA-11314/    # Папка диалога\n"))
+		content.WriteString(fmt.Sprintf("│   │   ├── conv_AAA-11314_info.json\n"))
+		content.WriteString(fmt.Sprintf("│   │   ├── conv_AAA-11314_chat.json\n"))
+		content.WriteString(fmt.Sprintf("│   │   └── trigger_info.txt    # Найденные триггеры\n"))
+		content.WriteString(fmt.Sprintf("│   └── BBB-22345/\n"))
+		content.WriteString(fmt.Sprintf("│       └── ...\n"))
+	}
+	content.WriteString("└── INDEX.md              # Этот файл\n")
+	content.WriteString("```\n\n")
+
+	content.WriteString("## Правила фильтрации\n\n")
+	content.WriteString("1. Проверяются только сообщения от клиентов (user_id с префиксом `user_`)\n")
+	content.WriteString("2. Триггеры ищутся как отдельные слова\n")
+	content.WriteString("3. Один диалог может относиться к нескольким типам проблем\n")
+	content.WriteString("4. Исходные папки диалогов сохраняются полностью со всеми файлами\n")
+
+	if err := afero.WriteFile(fs, indexPath, []byte(content.String()), 0644); err != nil {
+		fmt.Printf("Ошибка создания индексного файла: %v\n", err)
+	} else {
+		fmt.Printf("\nСоздан индексный файл: %s\n", indexPath)
+	}
+}
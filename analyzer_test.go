@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// seedDialog создаёт в fs папку folderName с одним conv_<id>_chat.json,
+// содержащим один клиентский месседж text.
+func seedDialog(t *testing.T, fs afero.Fs, inputDir, folderName, dialogID, text string) {
+	t.Helper()
+
+	chat := ConversationChat{
+		Messages: []Message{
+			{UserID: "user_1", Text: text, Timestamp: "2024-01-01T10:00:00Z"},
+		},
+	}
+	body, err := json.Marshal(chat)
+	if err != nil {
+		t.Fatalf("маршалинг чата: %v", err)
+	}
+
+	chatPath := filepath.Join(inputDir, folderName, "conv_"+dialogID+"_chat.json")
+	if err := afero.WriteFile(fs, chatPath, body, 0644); err != nil {
+		t.Fatalf("запись %s: %v", chatPath, err)
+	}
+}
+
+func TestAnalyzeDialogFolder(t *testing.T) {
+	setProblemTypes(map[string]ProblemType{
+		"refund": {Name: "Возврат средств", Triggers: []string{"верните деньги"}},
+		"delay":  {Name: "Задержка доставки", Triggers: []string{"где мой заказ"}},
+	})
+
+	cases := []struct {
+		name      string
+		text      string
+		wantTypes []string
+	}{
+		{"refund trigger", "Верните деньги немедленно!", []string{"refund"}},
+		{"delay trigger", "Где мой заказ, уже неделя прошла", []string{"delay"}},
+		{"no trigger", "Спасибо, всё отлично", nil},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			inputDir := "/input"
+			seedDialog(t, fs, inputDir, "AAA-1", "AAA-1", tc.text)
+
+			dialog := analyzeDialogFolder(fs, filepath.Join(inputDir, "AAA-1"), "AAA-1")
+
+			if tc.wantTypes == nil {
+				if dialog != nil {
+					t.Fatalf("ожидали nil, получили %+v", dialog)
+				}
+				return
+			}
+
+			if dialog == nil {
+				t.Fatalf("ожидали диалог с типами %v, получили nil", tc.wantTypes)
+			}
+			if len(dialog.Types) != len(tc.wantTypes) || dialog.Types[0] != tc.wantTypes[0] {
+				t.Fatalf("типы = %v, ожидали %v", dialog.Types, tc.wantTypes)
+			}
+		})
+	}
+}
+
+func TestMemAnalyzerRunOnce(t *testing.T) {
+	setProblemTypes(map[string]ProblemType{
+		"refund": {Name: "Возврат средств", Triggers: []string{"верните деньги"}},
+	})
+
+	analyzer := NewMemAnalyzer("/input", "/output")
+	seedDialog(t, analyzer.FS, "/input", "AAA-1", "AAA-1", "Верните деньги немедленно!")
+	seedDialog(t, analyzer.FS, "/input", "BBB-2", "BBB-2", "Спасибо, всё отлично")
+
+	if err := analyzer.RunOnce(); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+
+	exists, err := afero.Exists(analyzer.OutputFS, "/output/refund/AAA-1/trigger_info.txt")
+	if err != nil {
+		t.Fatalf("проверка trigger_info.txt: %v", err)
+	}
+	if !exists {
+		t.Fatal("ожидали trigger_info.txt для AAA-1 в /output/refund")
+	}
+
+	indexExists, err := afero.Exists(analyzer.OutputFS, "/output/INDEX.md")
+	if err != nil {
+		t.Fatalf("проверка INDEX.md: %v", err)
+	}
+	if !indexExists {
+		t.Fatal("ожидали /output/INDEX.md")
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/afero"
+)
+
+// dialogCacheFileName - имя файла персистентного кэша под OutputBaseDir.
+const dialogCacheFileName = ".dialog_cache.json"
+
+// fileStat - идентичность и размер файла/папки на момент последнего скана:
+// (dev, ino) на Unix берутся из syscall.Stat_t (см. cache_unix.go), на Windows
+// опознаются только по mtime/size (см. cache_windows.go).
+type fileStat struct {
+	Dev   uint64
+	Ino   uint64
+	Mtime int64
+	Size  int64
+}
+
+// cacheEntry - закэшированный результат анализа одной папки диалога.
+type cacheEntry struct {
+	Folder      fileStat
+	Files       map[string]fileStat
+	TriggerHash string
+	Result      *ProblematicDialog
+}
+
+// DialogCache - персистентный JSON-кэш результатов analyzeDialogFolder,
+// портирующий паттерн fsCacheT из kati: вместо хэширования содержимого кэш
+// хранит (dev, ino, mtime, size) папки и каждого её *_chat.json файла, плюс
+// хэш активного набора триггеров. Если с прошлого запуска ничего из этого не
+// изменилось, результат переиспользуется без повторного парсинга JSON.
+type DialogCache struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// LoadDialogCache читает outputBaseDir/.dialog_cache.json. Отсутствие или
+// повреждённость файла не считается ошибкой - это просто холодный старт.
+func LoadDialogCache(fs afero.Fs, outputBaseDir string) *DialogCache {
+	c := &DialogCache{
+		path:    filepath.Join(outputBaseDir, dialogCacheFileName),
+		entries: make(map[string]cacheEntry),
+	}
+
+	content, err := afero.ReadFile(fs, c.path)
+	if err != nil {
+		return c
+	}
+	if err := json.Unmarshal(content, &c.entries); err != nil {
+		fmt.Printf("Кэш %s повреждён, будет пересоздан: %v\n", c.path, err)
+		c.entries = make(map[string]cacheEntry)
+	}
+	return c
+}
+
+// Save сохраняет кэш в outputBaseDir/.dialog_cache.json.
+func (c *DialogCache) Save(fs afero.Fs) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	body, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("сериализация кэша: %w", err)
+	}
+	return afero.WriteFile(fs, c.path, body, 0644)
+}
+
+// Reset очищает все записи кэша - используется для --rebuild-cache.
+func (c *DialogCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]cacheEntry)
+}
+
+// statFolder снимает fileStat для самой папки и всех её *_chat.json файлов.
+func statFolder(fs afero.Fs, folderPath string) (fileStat, map[string]fileStat, error) {
+	folderInfo, err := fs.Stat(folderPath)
+	if err != nil {
+		return fileStat{}, nil, err
+	}
+	folderDev, folderIno := fileIdentity(folderInfo)
+	folder := fileStat{Dev: folderDev, Ino: folderIno, Mtime: folderInfo.ModTime().Unix(), Size: folderInfo.Size()}
+
+	entries, err := afero.ReadDir(fs, folderPath)
+	if err != nil {
+		return fileStat{}, nil, err
+	}
+
+	files := make(map[string]fileStat)
+	for _, entry := range entries {
+		if !strings.Contains(entry.Name(), "_chat.json") {
+			continue
+		}
+		dev, ino := fileIdentity(entry)
+		files[entry.Name()] = fileStat{Dev: dev, Ino: ino, Mtime: entry.ModTime().Unix(), Size: entry.Size()}
+	}
+
+	return folder, files, nil
+}
+
+// Lookup возвращает закэшированный результат для folderPath, если ни папка,
+// ни один из её *_chat.json файлов не изменились с момента записи, и активный
+// набор триггеров (triggerHash) совпадает с тем, которым результат был получен.
+func (c *DialogCache) Lookup(fs afero.Fs, folderPath, triggerHash string) (*ProblematicDialog, bool) {
+	folder, files, err := statFolder(fs, folderPath)
+	if err != nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[folderPath]
+	c.mu.Unlock()
+	if !ok || entry.TriggerHash != triggerHash || entry.Folder != folder || len(entry.Files) != len(files) {
+		return nil, false
+	}
+
+	for name, stat := range files {
+		if entry.Files[name] != stat {
+			return nil, false
+		}
+	}
+
+	return entry.Result, true
+}
+
+// Store запоминает результат анализа folderPath вместе с текущими стат-данными
+// и хэшем набора триггеров, которым он был получен.
+func (c *DialogCache) Store(fs afero.Fs, folderPath, triggerHash string, result *ProblematicDialog) {
+	folder, files, err := statFolder(fs, folderPath)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.entries[folderPath] = cacheEntry{Folder: folder, Files: files, TriggerHash: triggerHash, Result: result}
+	c.mu.Unlock()
+}
+
+// TriggerSetHash возвращает стабильный хэш активного набора problemTypes.
+// Используется, чтобы инвалидировать кэш целиком при смене конфигурации триггеров.
+func TriggerSetHash() string {
+	problemTypesMu.RLock()
+	defer problemTypesMu.RUnlock()
+
+	keys := make([]string, 0, len(problemTypes))
+	for typeKey := range problemTypes {
+		keys = append(keys, typeKey)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, typeKey := range keys {
+		info := problemTypes[typeKey]
+		fmt.Fprintf(h, "%s=%s|", typeKey, info.Name)
+
+		triggers := append([]string(nil), info.Triggers...)
+		sort.Strings(triggers)
+		for _, trigger := range triggers {
+			fmt.Fprintf(h, "%s,", trigger)
+		}
+		fmt.Fprint(h, ";")
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileIdentity возвращает (dev, ino) файла из syscall.Stat_t - на Unix это
+// единственный надёжный способ узнать, что папка или файл физически не
+// менялись, даже если их mtime совпал по секундам.
+func fileIdentity(info os.FileInfo) (dev, ino uint64) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return uint64(st.Dev), uint64(st.Ino)
+}
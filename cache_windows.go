@@ -0,0 +1,13 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// fileIdentity на Windows: afero не даёт доступа к индексу файла (требуется
+// GetFileInformationByHandle через отдельный os.Open), поэтому полагаемся
+// только на mtime и размер из statFolder - этого достаточно, чтобы заметить
+// изменение содержимого, просто без защиты от искусственно подделанного mtime.
+func fileIdentity(info os.FileInfo) (dev, ino uint64) {
+	return 0, 0
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"gopkg.in/ini.v1"
+)
+
+// Config - полная конфигурация приложения, загружаемая из INI файла.
+// Заменяет прежние захардкоженные inputDir/outputBaseDir и неявные
+// problemTypes/таблицы триггеров.
+type Config struct {
+	Paths      PathsConfig
+	Matching   MatchingConfig
+	OpenSearch OpenSearchConfig
+	Types      map[string]ProblemType
+}
+
+// PathsConfig - секция [paths].
+type PathsConfig struct {
+	InputDir      string
+	OutputBaseDir string
+}
+
+// MatchingConfig - секция [matching]: общее поведение движка поиска триггеров.
+type MatchingConfig struct {
+	CaseSensitive  bool
+	WordBoundary   bool // true - искать по границам слов, false - по подстроке
+	Fuzzy          bool
+	FuzzyThreshold float64
+}
+
+// defaultConfig - конфигурация, которую --createconfig пишет на диск, и
+// одновременно значения по умолчанию для запуска без --config вовсе.
+func defaultConfig() *Config {
+	return &Config{
+		Paths: PathsConfig{
+			InputDir:      "./output/conversations",
+			OutputBaseDir: "./problematicDialogs",
+		},
+		Matching: MatchingConfig{
+			CaseSensitive:  false,
+			WordBoundary:   true,
+			Fuzzy:          false,
+			FuzzyThreshold: 0.2,
+		},
+		OpenSearch: OpenSearchConfig{
+			IndexPrefix: "dialogs",
+		},
+		Types: map[string]ProblemType{
+			"refund": {Name: "Возврат средств", Triggers: []string{"возврат денег", "верните деньги"}},
+			"delay":  {Name: "Задержка доставки", Triggers: []string{"где мой заказ", "долго везете"}},
+		},
+	}
+}
+
+// WriteDefaultConfig пишет конфигурацию по умолчанию в path. Отказывается
+// перезаписывать уже существующий файл.
+func WriteDefaultConfig(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("файл %s уже существует", path)
+	}
+
+	cfg := defaultConfig()
+	file := ini.Empty()
+
+	paths, _ := file.NewSection("paths")
+	paths.NewKey("input_dir", cfg.Paths.InputDir)
+	paths.NewKey("output_base_dir", cfg.Paths.OutputBaseDir)
+
+	matching, _ := file.NewSection("matching")
+	matching.NewKey("case_sensitive", strconv.FormatBool(cfg.Matching.CaseSensitive))
+	matching.NewKey("word_boundary", strconv.FormatBool(cfg.Matching.WordBoundary))
+	matching.NewKey("fuzzy", strconv.FormatBool(cfg.Matching.Fuzzy))
+	matching.NewKey("fuzzy_threshold", strconv.FormatFloat(cfg.Matching.FuzzyThreshold, 'f', -1, 64))
+
+	for typeKey, info := range cfg.Types {
+		section, _ := file.NewSection(fmt.Sprintf(`type "%s"`, typeKey))
+		section.NewKey("name", info.Name)
+		section.NewKey("triggers", strings.Join(info.Triggers, ", "))
+	}
+
+	opensearch, _ := file.NewSection("opensearch")
+	opensearch.NewKey("addresses", "")
+	opensearch.NewKey("username", "")
+	opensearch.NewKey("password", "")
+	opensearch.NewKey("insecure_skip_verify", "false")
+	opensearch.NewKey("index_prefix", cfg.OpenSearch.IndexPrefix)
+
+	return file.SaveTo(path)
+}
+
+// LoadConfig читает INI файл и собирает Config, включая одну секцию
+// [type "<key>"] на категорию проблем.
+func LoadConfig(path string) (*Config, error) {
+	file, err := ini.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("чтение конфигурации %s: %w", path, err)
+	}
+	return parseConfig(file)
+}
+
+func parseConfig(file *ini.File) (*Config, error) {
+	cfg := &Config{Types: make(map[string]ProblemType)}
+
+	paths := file.Section("paths")
+	cfg.Paths.InputDir = paths.Key("input_dir").MustString("./output/conversations")
+	cfg.Paths.OutputBaseDir = paths.Key("output_base_dir").MustString("./problematicDialogs")
+
+	matching := file.Section("matching")
+	cfg.Matching.CaseSensitive = matching.Key("case_sensitive").MustBool(false)
+	cfg.Matching.WordBoundary = matching.Key("word_boundary").MustBool(true)
+	cfg.Matching.Fuzzy = matching.Key("fuzzy").MustBool(false)
+	cfg.Matching.FuzzyThreshold = matching.Key("fuzzy_threshold").MustFloat64(0.2)
+
+	for _, section := range file.Sections() {
+		name := section.Name()
+		if !strings.HasPrefix(name, `type "`) || !strings.HasSuffix(name, `"`) {
+			continue
+		}
+		typeKey := strings.TrimSuffix(strings.TrimPrefix(name, `type "`), `"`)
+
+		triggers := section.Key("triggers").Strings(",")
+		for i := range triggers {
+			triggers[i] = strings.TrimSpace(triggers[i])
+		}
+
+		cfg.Types[typeKey] = ProblemType{
+			Name:           section.Key("name").MustString(typeKey),
+			Triggers:       triggers,
+			FuzzyThreshold: section.Key("fuzzy_threshold").MustFloat64(0),
+		}
+	}
+
+	osSection := file.Section("opensearch")
+	cfg.OpenSearch = OpenSearchConfig{
+		Addresses:          osSection.Key("addresses").Strings(","),
+		Username:           osSection.Key("username").MustString(""),
+		Password:           osSection.Key("password").MustString(""),
+		InsecureSkipVerify: osSection.Key("insecure_skip_verify").MustBool(false),
+		IndexPrefix:        osSection.Key("index_prefix").MustString("dialogs"),
+	}
+
+	return cfg, nil
+}
+
+// Apply активирует конфигурацию: перекомпилирует триггеры и атомарно заменяет
+// активный набор problemTypes. Вызывается при старте и при каждом SIGHUP reload.
+func (c *Config) Apply() {
+	SetMatchingConfig(c.Matching)
+	setProblemTypes(c.Types)
+}
+
+// WatchReload подписывается на SIGHUP и при каждом сигнале перечитывает
+// конфигурацию по path, заменяя скомпилированный набор триггеров через
+// Config.Apply без остановки уже запущенных горутин анализа.
+func WatchReload(path string) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	go func() {
+		for range sighup {
+			cfg, err := LoadConfig(path)
+			if err != nil {
+				fmt.Printf("Ошибка перезагрузки конфигурации: %v\n", err)
+				continue
+			}
+			cfg.Apply()
+			fmt.Printf("Конфигурация %s перезагружена по SIGHUP\n", path)
+		}
+	}()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// debounceWindow - сколько ждать тишины в папке диалога, прежде чем считать
+// её дозаписанной и запускать анализ. Диалоги пишутся несколькими файлами
+// подряд (info.json, chat.json), поэтому реагировать на первое же событие нельзя.
+const debounceWindow = 2 * time.Second
+
+// RunDaemon запускает анализатор в режиме долгоживущего процесса: следит за
+// InputDir через fsnotify, дебаунсит события по каждой папке и инкрементально
+// прогоняет через них analyzer.AnalyzeFolder. stop, если передан, останавливает
+// демон при закрытии канала - используется при управлении через kardianos/service.
+func RunDaemon(analyzer *Analyzer, stop <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("создание fsnotify watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(analyzer.InputDir); err != nil {
+		return fmt.Errorf("подписка на %s: %w", analyzer.InputDir, err)
+	}
+
+	fmt.Printf("Демон запущен, наблюдение за %s\n", analyzer.InputDir)
+
+	pending := make(map[string]*time.Timer)
+	results := make(chan string)
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Write) == 0 {
+				continue
+			}
+
+			// Диалог пишется несколькими файлами подряд внутри только что
+			// созданной подпапки. fsnotify не следит за вложенными каталогами
+			// сам, поэтому без явной подписки на новую подпапку дальнейшие
+			// Write-события info.json/chat.json внутри неё никогда не придут,
+			// и дебаунс ниже сработает почти сразу после mkdir.
+			if event.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := watcher.Add(event.Name); err != nil {
+						fmt.Printf("Ошибка подписки на %s: %v\n", event.Name, err)
+					}
+				}
+			}
+
+			folderName := folderNameFromEvent(event.Name, analyzer.InputDir)
+			if folderName == "" {
+				continue
+			}
+
+			if timer, exists := pending[folderName]; exists {
+				timer.Reset(debounceWindow)
+				continue
+			}
+
+			pending[folderName] = time.AfterFunc(debounceWindow, func() {
+				results <- folderName
+			})
+
+		case folderName := <-results:
+			delete(pending, folderName)
+			if _, err := analyzer.AnalyzeFolder(folderName); err != nil {
+				fmt.Printf("Ошибка анализа папки %s: %v\n", folderName, err)
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Printf("Ошибка watcher: %v\n", err)
+
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+// folderNameFromEvent извлекает имя папки верхнего уровня диалога из пути
+// события fsnotify, либо возвращает "" если событие не относится к InputDir.
+func folderNameFromEvent(path, inputDir string) string {
+	rel, err := filepath.Rel(inputDir, path)
+	if err != nil || rel == "." || rel == "" {
+		return ""
+	}
+	return strings.SplitN(rel, string(filepath.Separator), 2)[0]
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// TriggerHit описывает одно найденное вхождение триггера в тексте сообщения:
+// сам совпавший фрагмент, оценку схожести (1.0 для точного совпадения, ниже -
+// для нечёткого) и признак того, что совпадение найдено приближённым (fuzzy)
+// поиском, а не предкомпилированным регулярным выражением.
+type TriggerHit struct {
+	Text  string  `json:"text"`
+	Score float64 `json:"score"`
+	Fuzzy bool    `json:"fuzzy"`
+}
+
+// fuzzyTrigger - триггер, подготовленный для нечёткого поиска: помимо самой
+// фразы хранит число слов в ней (чтобы сравнивать только с n-граммами той же
+// длины) и порог относительного расстояния Левенштейна.
+type fuzzyTrigger struct {
+	trigger   string
+	wordCount int
+	threshold float64
+}
+
+// tokenize разбивает текст сообщения на слова по пробелам и пунктуации.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// trigramsOf возвращает множество символьных триграмм строки - используется
+// как дешёвый префильтр перед точным вычислением расстояния Левенштейна,
+// чтобы не сравнивать каждую n-грамму текста с каждым триггером.
+func trigramsOf(s string) map[string]bool {
+	trigrams := make(map[string]bool)
+	padded := "  " + s + "  "
+	runes := []rune(padded)
+	for i := 0; i+3 <= len(runes); i++ {
+		trigrams[string(runes[i:i+3])] = true
+	}
+	return trigrams
+}
+
+// levenshtein вычисляет классическое расстояние редактирования между a и b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(curr[j-1]+1, prev[j]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// normalizedLevenshtein возвращает расстояние Левенштейна, делённое на длину
+// более длинной из двух строк, так что результат лежит в [0, 1].
+func normalizedLevenshtein(a, b string) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+	dist := levenshtein(a, b)
+	maxLen := len([]rune(a))
+	if bl := len([]rune(b)); bl > maxLen {
+		maxLen = bl
+	}
+	return float64(dist) / float64(maxLen)
+}
+
+// fuzzyMatchType ищет нечёткие вхождения всех триггеров типа typeKey в text.
+// Текст предварительно токенизируется, и для каждого триггера перебираются
+// n-граммы токенов того же количества слов, что и в триггере. Триграммный
+// индекс (trigram -> индексы триггеров) отсеивает заведомо непохожие триггеры
+// до дорогого вычисления расстояния Левенштейна.
+func fuzzyMatchType(typeKey, text string) []TriggerHit {
+	fuzzyMu.RLock()
+	triggers := fuzzyTriggers[typeKey]
+	trigramIdx := fuzzyTrigramIdx[typeKey]
+	fuzzyMu.RUnlock()
+
+	if len(triggers) == 0 {
+		return nil
+	}
+
+	tokens := tokenize(text)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	textTrigrams := trigramsOf(text)
+	candidateSet := make(map[int]bool)
+	for trigram := range textTrigrams {
+		for _, idx := range trigramIdx[trigram] {
+			candidateSet[idx] = true
+		}
+	}
+
+	var hits []TriggerHit
+	for idx := range candidateSet {
+		ft := triggers[idx]
+		for start := 0; start+ft.wordCount <= len(tokens); start++ {
+			candidate := strings.Join(tokens[start:start+ft.wordCount], " ")
+			dist := normalizedLevenshtein(ft.trigger, candidate)
+			if dist <= ft.threshold {
+				hits = append(hits, TriggerHit{
+					Text:  candidate,
+					Score: 1 - dist,
+					Fuzzy: true,
+				})
+				break
+			}
+		}
+	}
+
+	return hits
+}
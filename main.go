@@ -2,13 +2,15 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
-	"sync"
+
+	"github.com/spf13/afero"
 )
 
 // Структуры для чтения JSON файлов
@@ -33,133 +35,118 @@ type ConversationChat struct {
 
 // Структура для хранения диалога с его типами
 type ProblematicDialog struct {
-	FolderName string   // Название папки диалога (например, "AAA-11314")
-	ID         string   // ID диалога (из названия файлов)
-	Types      []string // Типы проблем
-	Files      []string // Файлы в папке
-	Triggers   []string // Триггеры, которые были найдены
+	FolderName string       // Название папки диалога (например, "AAA-11314")
+	ID         string       // ID диалога (из названия файлов)
+	Types      []string     // Типы проблем
+	Files      []string     // Файлы в папке
+	Triggers   []TriggerHit // Сработавшие триггеры, точные и нечёткие
 }
 
 // Регулярные выражения для поиска ID диалога из имен файлов
 var convFilePattern = regexp.MustCompile(`conv_([A-Z]+-\d+)_`)
 
 func main() {
-	// Инициализируем problemTypes если нужно
-	if len(problemTypes) == 0 {
-		initializeProblemTypes()
-	}
-
-	// Очищаем и сортируем триггеры
-	CleanTriggers()
-
-	// Пути
-	inputDir := "./output/conversations"
-	outputBaseDir := "./problematicDialogs"
-
-	// Создаем выходные директории для каждого типа
-	for typeKey := range problemTypes {
-		typeDir := filepath.Join(outputBaseDir, typeKey)
-		if err := os.MkdirAll(typeDir, 0755); err != nil {
-			fmt.Printf("Ошибка создания директории %s: %v\n", typeDir, err)
-			return
+	if len(os.Args) > 1 && os.Args[1] == "search" {
+		if err := runSearchCommand(os.Args[2:]); err != nil {
+			fmt.Printf("Ошибка поиска: %v\n", err)
+			os.Exit(1)
 		}
+		return
 	}
 
-	// Получаем список папок с диалогами
-	folders, err := ioutil.ReadDir(inputDir)
-	if err != nil {
-		fmt.Printf("Ошибка чтения директории: %v\n", err)
+	configPath := flag.String("config", "", "Путь к INI конфигурации")
+	createConfig := flag.Bool("createconfig", false, "Создать конфигурацию по умолчанию по пути --config и выйти")
+	inputDir := flag.String("input", "", "Директория с папками диалогов (переопределяет [paths] из конфигурации)")
+	outputBaseDir := flag.String("output", "", "Директория для результатов (переопределяет [paths] из конфигурации)")
+	daemonMode := flag.Bool("daemon", false, "Запустить в режиме демона (следить за input через fsnotify)")
+	serviceCmd := flag.String("service", "", "Управление службой: install|start|stop|uninstall")
+	exportMbox := flag.Bool("export-mbox", false, "Дополнительно экспортировать каждый диалог в mbox-файл по типу проблемы")
+	exportOS := flag.Bool("export-os", false, "Дополнительно индексировать каждый диалог в OpenSearch/Elasticsearch (см. [opensearch] в конфигурации)")
+	rebuildCache := flag.Bool("rebuild-cache", false, "Игнорировать .dialog_cache.json и пересканировать все папки заново")
+	flag.Parse()
+
+	if *createConfig {
+		path := *configPath
+		if path == "" {
+			path = "dialog-analyzer.ini"
+		}
+		if err := WriteDefaultConfig(path); err != nil {
+			fmt.Printf("Ошибка создания конфигурации: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Создана конфигурация по умолчанию: %s\n", path)
 		return
 	}
 
-	// Канал для сбора проблемных диалогов
-	problematicDialogs := make(chan *ProblematicDialog, 100)
-	var wg sync.WaitGroup
-
-	// Обрабатываем каждую папку параллельно
-	for _, folder := range folders {
-		if !folder.IsDir() {
-			continue
+	cfg := defaultConfig()
+	if *configPath != "" {
+		loaded, err := LoadConfig(*configPath)
+		if err != nil {
+			fmt.Printf("Ошибка загрузки конфигурации: %v\n", err)
+			os.Exit(1)
 		}
-
-		wg.Add(1)
-		go func(folderName string) {
-			defer wg.Done()
-
-			dialogPath := filepath.Join(inputDir, folderName)
-			if dialog := analyzeDialogFolder(dialogPath, folderName); dialog != nil {
-				problematicDialogs <- dialog
-			}
-		}(folder.Name())
+		cfg = loaded
+		WatchReload(*configPath)
 	}
+	cfg.Apply()
 
-	// Ждем завершения всех горутин
-	go func() {
-		wg.Wait()
-		close(problematicDialogs)
-	}()
-
-	// Собираем статистику
-	stats := make(map[string]int)
-	allDialogs := make(map[string][]*ProblematicDialog)
-
-	// Обрабатываем проблемные диалоги
-	for dialog := range problematicDialogs {
-		// Копируем папку диалога в соответствующие папки типов
-		for _, typeKey := range dialog.Types {
-			stats[typeKey]++
-
-			// Создаем папку для диалога в директории типа
-			typeDir := filepath.Join(outputBaseDir, typeKey, dialog.FolderName)
-			if err := os.MkdirAll(typeDir, 0755); err != nil {
-				fmt.Printf("Ошибка создания директории для диалога: %v\n", err)
-				continue
-			}
-
-			// Копируем все файлы из исходной папки
-			for _, file := range dialog.Files {
-				srcPath := filepath.Join(inputDir, dialog.FolderName, file)
-				dstPath := filepath.Join(typeDir, file)
-
-				input, err := ioutil.ReadFile(srcPath)
-				if err != nil {
-					fmt.Printf("Ошибка чтения файла %s: %v\n", file, err)
-					continue
-				}
+	effectiveInput := cfg.Paths.InputDir
+	if *inputDir != "" {
+		effectiveInput = *inputDir
+	}
+	effectiveOutput := cfg.Paths.OutputBaseDir
+	if *outputBaseDir != "" {
+		effectiveOutput = *outputBaseDir
+	}
 
-				err = ioutil.WriteFile(dstPath, input, 0644)
-				if err != nil {
-					fmt.Printf("Ошибка копирования файла %s: %v\n", file, err)
-				}
-			}
+	if *serviceCmd != "" {
+		if err := runServiceCommand(*serviceCmd, effectiveInput, effectiveOutput); err != nil {
+			fmt.Printf("Ошибка управления службой: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-			// Создаем файл с информацией о найденных триггерах
-			infoFile := filepath.Join(typeDir, "trigger_info.txt")
-			infoContent := fmt.Sprintf("Диалог: %s\nТип: %s\nПапка: %s\nНайденные триггеры:\n",
-				dialog.ID, problemTypes[typeKey].Name, dialog.FolderName)
-			for _, trigger := range dialog.Triggers {
-				infoContent += fmt.Sprintf("- %s\n", trigger)
-			}
+	analyzer := NewOSAnalyzer(effectiveInput, effectiveOutput)
+	if *exportMbox {
+		analyzer.Sinks = append(analyzer.Sinks, NewMboxExportSink(analyzer.FS, effectiveInput, effectiveOutput))
+	}
+	if *exportOS {
+		osSink, err := NewOpenSearchSink(cfg.OpenSearch)
+		if err != nil {
+			fmt.Printf("Ошибка подключения к OpenSearch: %v\n", err)
+			os.Exit(1)
+		}
+		defer osSink.Close()
+		analyzer.Sinks = append(analyzer.Sinks, NewOpenSearchResultSink(analyzer.FS, effectiveInput, osSink))
+	}
 
-			if err := ioutil.WriteFile(infoFile, []byte(infoContent), 0644); err != nil {
-				fmt.Printf("Ошибка создания файла информации: %v\n", err)
-			}
+	analyzer.Cache = LoadDialogCache(analyzer.OutputFS, effectiveOutput)
+	if *rebuildCache {
+		analyzer.Cache.Reset()
+	}
 
-			allDialogs[typeKey] = append(allDialogs[typeKey], dialog)
+	if *daemonMode {
+		if err := RunDaemon(analyzer, nil); err != nil {
+			fmt.Printf("Ошибка демона: %v\n", err)
+			os.Exit(1)
 		}
+		return
 	}
 
-	// Выводим статистику
-	printStatistics(stats, allDialogs)
-
-	// Создаем индексный файл
-	createIndexFile(outputBaseDir, stats, allDialogs)
+	if err := analyzer.RunOnce(); err != nil {
+		fmt.Printf("Ошибка анализа: %v\n", err)
+		os.Exit(1)
+	}
 }
 
-// Анализирует папку диалога и возвращает информацию о проблемных типах
-func analyzeDialogFolder(folderPath, folderName string) *ProblematicDialog {
+// Анализирует папку диалога и возвращает информацию о проблемных типах.
+// fs абстрагирует файловую систему, так что диалоги можно анализировать
+// не только на диске, но и внутри архива (NewZipAnalyzer) или в памяти
+// (NewMemAnalyzer, используется в тестах).
+func analyzeDialogFolder(fs afero.Fs, folderPath, folderName string) *ProblematicDialog {
 	// Получаем список файлов в папке
-	files, err := ioutil.ReadDir(folderPath)
+	files, err := afero.ReadDir(fs, folderPath)
 	if err != nil {
 		return nil
 	}
@@ -172,7 +159,8 @@ func analyzeDialogFolder(folderPath, folderName string) *ProblematicDialog {
 	// Ищем файлы диалога
 	var dialogID string
 	foundTypes := make(map[string]bool)
-	var foundTriggers []string
+	var foundTriggers []TriggerHit
+	types := currentProblemTypes()
 
 	for _, fileName := range fileNames {
 		// Проверяем только chat файлы
@@ -188,7 +176,7 @@ func analyzeDialogFolder(folderPath, folderName string) *ProblematicDialog {
 				dialogID = folderName
 			}
 
-			content, err := ioutil.ReadFile(filePath)
+			content, err := afero.ReadFile(fs, filePath)
 			if err != nil {
 				continue
 			}
@@ -205,10 +193,13 @@ func analyzeDialogFolder(folderPath, folderName string) *ProblematicDialog {
 					continue
 				}
 
-				text := strings.ToLower(msg.Text)
+				text := msg.Text
+				if !MatchingCaseSensitive() {
+					text = strings.ToLower(text)
+				}
 
 				// Проверяем триггеры для каждого типа через предкомпилированные паттерны
-				for typeKey, typeInfo := range problemTypes {
+				for typeKey := range types {
 					matches := FindPatternMatches(text, typeKey)
 					if len(matches) == 0 {
 						continue
@@ -219,7 +210,7 @@ func analyzeDialogFolder(folderPath, folderName string) *ProblematicDialog {
 					for _, match := range matches {
 						triggerExists := false
 						for _, t := range foundTriggers {
-							if strings.EqualFold(t, match) {
+							if strings.EqualFold(t.Text, match.Text) {
 								triggerExists = true
 								break
 							}
@@ -254,143 +245,3 @@ func analyzeDialogFolder(folderPath, folderName string) *ProblematicDialog {
 
 	return nil
 }
-
-// Выводит статистику
-func printStatistics(stats map[string]int, allDialogs map[string][]*ProblematicDialog) {
-	fmt.Println("=== СТАТИСТИКА ПРОБЛЕМНЫХ ДИАЛОГОВ ===")
-	fmt.Println()
-
-	// Сортируем типы по количеству диалогов
-	type StatsItem struct {
-		TypeKey string
-		Count   int
-	}
-
-	var statsList []StatsItem
-	for typeKey, count := range stats {
-		statsList = append(statsList, StatsItem{typeKey, count})
-	}
-
-	sort.Slice(statsList, func(i, j int) bool {
-		return statsList[i].Count > statsList[j].Count
-	})
-
-	total := 0
-	for _, item := range statsList {
-		typeName := problemTypes[item.TypeKey].Name
-		fmt.Printf("%s: %d диалогов\n", typeName, item.Count)
-		total += item.Count
-
-		// Выводим первые 3 диалога этого типа
-		if dialogs, ok := allDialogs[item.TypeKey]; ok && len(dialogs) > 0 {
-			fmt.Printf("  Примеры диалогов: ")
-			count := 0
-			for _, dialog := range dialogs {
-				if count >= 3 {
-					break
-				}
-				fmt.Printf("%s ", dialog.FolderName)
-				count++
-			}
-			fmt.Println()
-		}
-	}
-
-	fmt.Printf("\nВсего проблемных диалогов: %d\n", total)
-
-	// Выводим наиболее частые триггеры
-	fmt.Println("\n=== НАИБОЛЕЕ ЧАСТЫЕ ТРИГГЕРЫ ===")
-
-	// Собираем все триггеры и их частоту
-	triggerStats := make(map[string]int)
-	for _, dialogs := range allDialogs {
-		for _, dialog := range dialogs {
-			for _, trigger := range dialog.Triggers {
-				triggerStats[trigger]++
-			}
-		}
-	}
-
-	// Сортируем триггеры по частоте
-	var triggerList []struct {
-		Trigger string
-		Count   int
-	}
-
-	for trigger, count := range triggerStats {
-		triggerList = append(triggerList, struct {
-			Trigger string
-			Count   int
-		}{trigger, count})
-	}
-
-	sort.Slice(triggerList, func(i, j int) bool {
-		return triggerList[i].Count > triggerList[j].Count
-	})
-
-	// Выводим топ-10 триггеров
-	fmt.Println("Топ-10 самых частых триггеров:")
-	for i := 0; i < 10 && i < len(triggerList); i++ {
-		fmt.Printf("%d. %s (%d раз)\n", i+1, triggerList[i].Trigger, triggerList[i].Count)
-	}
-}
-
-// Создает индексный файл со всей статистикой
-func createIndexFile(outputBaseDir string, stats map[string]int, allDialogs map[string][]*ProblematicDialog) {
-	indexPath := filepath.Join(outputBaseDir, "INDEX.md")
-
-	var content strings.Builder
-	content.WriteString("# Индекс проблемных диалогов\n\n")
-	content.WriteString("## Статистика по типам проблем\n\n")
-
-	total := 0
-	for typeKey, count := range stats {
-		typeName := problemTypes[typeKey].Name
-		content.WriteString(fmt.Sprintf("### %s\n", typeName))
-		content.WriteString(fmt.Sprintf("- **Количество диалогов:** %d\n", count))
-		content.WriteString("- **Диалоги:** ")
-
-		// Перечисляем все диалоги этого типа
-		if dialogs, ok := allDialogs[typeKey]; ok && len(dialogs) > 0 {
-			for i, dialog := range dialogs {
-				if i > 0 {
-					content.WriteString(", ")
-				}
-				content.WriteString(dialog.FolderName)
-			}
-		}
-		content.WriteString("\n\n")
-
-		total += count
-	}
-
-	content.WriteString(fmt.Sprintf("## Всего проблемных диалогов: %d\n\n", total))
-
-	content.WriteString("## Структура директорий\n\n")
-	content.WriteString("```\n")
-	content.WriteString("problematicDialogs/\n")
-	for typeKey := range problemTypes {
-		typeName := problemTypes[typeKey].Name
-		content.WriteString(fmt.Sprintf("├── %s/                # %s\n", typeKey, typeName))
-		content.WriteString(fmt.Sprintf("│   ├── AAA-11314/    # Папка диалога\n"))
-		content.WriteString(fmt.Sprintf("│   │   ├── conv_AAA-11314_info.json\n"))
-		content.WriteString(fmt.Sprintf("│   │   ├── conv_AAA-11314_chat.json\n"))
-		content.WriteString(fmt.Sprintf("│   │   └── trigger_info.txt    # Найденные триггеры\n"))
-		content.WriteString(fmt.Sprintf("│   └── BBB-22345/\n"))
-		content.WriteString(fmt.Sprintf("│       └── ...\n"))
-	}
-	content.WriteString("└── INDEX.md              # Этот файл\n")
-	content.WriteString("```\n\n")
-
-	content.WriteString("## Правила фильтрации\n\n")
-	content.WriteString("1. Проверяются только сообщения от клиентов (user_id с префиксом `user_`)\n")
-	content.WriteString("2. Триггеры ищутся как отдельные слова\n")
-	content.WriteString("3. Один диалог может относиться к нескольким типам проблем\n")
-	content.WriteString("4. Исходные папки диалогов сохраняются полностью со всеми файлами\n")
-
-	if err := ioutil.WriteFile(indexPath, []byte(content.String()), 0644); err != nil {
-		fmt.Printf("Ошибка создания индексного файла: %v\n", err)
-	} else {
-		fmt.Printf("\nСоздан индексный файл: %s\n", indexPath)
-	}
-}
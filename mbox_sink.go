@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-mbox"
+	"github.com/spf13/afero"
+)
+
+// MboxExportSink пишет каждый проблемный диалог как RFC 4155 mbox-файл -
+// по одному файлу на диалог в outputBaseDir/<тип>/<папка>.mbox, так что
+// корпус доступен для почтовых клиентов и существующих mbox-инструментов
+// поиска/разметки без отдельного вьювера.
+type MboxExportSink struct {
+	FS            afero.Fs
+	InputDir      string
+	OutputBaseDir string
+}
+
+// NewMboxExportSink создаёт mbox-синк, читающий исходные файлы диалога из
+// InputDir на той же файловой системе, на которой работает анализатор.
+func NewMboxExportSink(fs afero.Fs, inputDir, outputBaseDir string) *MboxExportSink {
+	return &MboxExportSink{FS: fs, InputDir: inputDir, OutputBaseDir: outputBaseDir}
+}
+
+func (s *MboxExportSink) Handle(dialog *ProblematicDialog) error {
+	info, chat, err := s.loadDialog(dialog)
+	if err != nil {
+		return fmt.Errorf("чтение диалога %s: %w", dialog.FolderName, err)
+	}
+
+	for _, typeKey := range dialog.Types {
+		typeDir := filepath.Join(s.OutputBaseDir, typeKey)
+		if err := s.FS.MkdirAll(typeDir, 0755); err != nil {
+			fmt.Printf("Ошибка создания директории %s: %v\n", typeDir, err)
+			continue
+		}
+
+		mboxPath := filepath.Join(typeDir, dialog.FolderName+".mbox")
+		if err := s.writeMbox(mboxPath, dialog, info, chat); err != nil {
+			fmt.Printf("Ошибка экспорта mbox для %s: %v\n", dialog.FolderName, err)
+		}
+	}
+
+	return nil
+}
+
+// loadDialog перечитывает conv_*_info.json и conv_*_chat.json диалога -
+// ProblematicDialog хранит только список имён файлов, а для mbox нужны
+// и сами сообщения, и имена оператора/клиента.
+func (s *MboxExportSink) loadDialog(dialog *ProblematicDialog) (*ConversationInfo, *ConversationChat, error) {
+	var info ConversationInfo
+	var chat ConversationChat
+
+	for _, file := range dialog.Files {
+		path := filepath.Join(s.InputDir, dialog.FolderName, file)
+
+		switch {
+		case strings.Contains(file, "_info.json"):
+			content, err := afero.ReadFile(s.FS, path)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := json.Unmarshal(content, &info); err != nil {
+				return nil, nil, err
+			}
+		case strings.Contains(file, "_chat.json"):
+			content, err := afero.ReadFile(s.FS, path)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := json.Unmarshal(content, &chat); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return &info, &chat, nil
+}
+
+// writeMbox пишет одно сообщение mbox на каждое Message диалога: From/To
+// берутся из ConversationInfo в зависимости от того, кто писал (user_ -
+// клиент, иначе оператор), Subject включает ID диалога и список триггеров,
+// а X-Trigger добавляется отдельной строкой на каждое сработавшее срабатывание.
+func (s *MboxExportSink) writeMbox(path string, dialog *ProblematicDialog, info *ConversationInfo, chat *ConversationChat) error {
+	out, err := s.FS.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	writer := mbox.NewWriter(out)
+	defer writer.Close()
+
+	triggerList := make([]string, 0, len(dialog.Triggers))
+	for _, t := range dialog.Triggers {
+		triggerList = append(triggerList, t.Text)
+	}
+	subject := fmt.Sprintf("[%s] %s", dialog.ID, strings.Join(triggerList, ", "))
+
+	for _, msg := range chat.Messages {
+		from, to := info.ClientName, info.OperatorName
+		if !strings.HasPrefix(msg.UserID, "user_") {
+			from, to = info.OperatorName, info.ClientName
+		}
+
+		date := parseMessageTimestamp(msg.Timestamp)
+
+		mw, err := writer.CreateMessage(from, date)
+		if err != nil {
+			return err
+		}
+
+		var body strings.Builder
+		fmt.Fprintf(&body, "From: %s\n", from)
+		fmt.Fprintf(&body, "To: %s\n", to)
+		fmt.Fprintf(&body, "Date: %s\n", date.Format(time.RFC1123Z))
+		fmt.Fprintf(&body, "Subject: %s\n", subject)
+		for _, trigger := range triggerList {
+			fmt.Fprintf(&body, "X-Trigger: %s\n", trigger)
+		}
+		body.WriteString("\n")
+		body.WriteString(msg.Text)
+		body.WriteString("\n")
+
+		if _, err := mw.Write([]byte(body.String())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseMessageTimestamp разбирает таймстамп сообщения, если он в формате
+// RFC 3339; при ошибке разбора возвращает нулевое время, чтобы не прерывать экспорт.
+func parseMessageTimestamp(timestamp string) time.Time {
+	if t, err := time.Parse(time.RFC3339, timestamp); err == nil {
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go"
+	"github.com/opensearch-project/opensearch-go/opensearchutil"
+	"github.com/spf13/afero"
+)
+
+// OpenSearchConfig описывает параметры подключения к кластеру OpenSearch/Elasticsearch
+// и поведение батчинга документов.
+type OpenSearchConfig struct {
+	Addresses          []string // адреса узлов, например ["https://localhost:9200"]
+	Username           string
+	Password           string
+	InsecureSkipVerify bool
+	IndexPrefix        string        // например "dialogs", итоговый индекс - "dialogs-2024.01"
+	FlushBytes         int           // размер батча в байтах, 0 - значение по умолчанию
+	FlushInterval      time.Duration // периодичность принудительного флаша
+	NumWorkers         int           // количество воркеров BulkIndexer, 0 - значение по умолчанию
+}
+
+// dialogDocument - документ, который отправляется в индекс для одного проблемного диалога.
+type dialogDocument struct {
+	FolderName   string       `json:"folder_name"`
+	DialogID     string       `json:"dialog_id"`
+	Types        []string     `json:"types"`
+	Triggers     []TriggerHit `json:"triggers"`
+	OperatorName string       `json:"operator_name"`
+	OperatorID   string       `json:"operator_id"`
+	ClientName   string       `json:"client_name"`
+	ClientID     string       `json:"client_id"`
+	Date         string       `json:"date"`
+	Direction    bool         `json:"direction_outgoing"`
+	Messages     []Message    `json:"messages"`
+	IndexedAt    time.Time    `json:"indexed_at"`
+}
+
+// OpenSearchSink пишет проблемные диалоги в OpenSearch/Elasticsearch через BulkIndexer.
+type OpenSearchSink struct {
+	cfg     OpenSearchConfig
+	client  *opensearch.Client
+	indexer opensearchutil.BulkIndexer
+}
+
+// newOpenSearchClient создаёт клиента OpenSearch/Elasticsearch из cfg - общую
+// точку для всего, что ходит в кластер (индексация через OpenSearchSink и
+// чтение корпуса через LoadCorpusFromOpenSearch), чтобы TLS/auth настройки не
+// расходились между ними.
+func newOpenSearchClient(cfg OpenSearchConfig) (*opensearch.Client, error) {
+	transport := &http.Transport{}
+	if cfg.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	client, err := opensearch.NewClient(opensearch.Config{
+		Addresses: cfg.Addresses,
+		Username:  cfg.Username,
+		Password:  cfg.Password,
+		Transport: transport,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("создание клиента OpenSearch: %w", err)
+	}
+	return client, nil
+}
+
+// NewOpenSearchSink поднимает клиента, настраивает BulkIndexer и прогоняет
+// bootstrap шаблона индекса перед первой записью.
+func NewOpenSearchSink(cfg OpenSearchConfig) (*OpenSearchSink, error) {
+	client, err := newOpenSearchClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ensureIndexTemplate(client, cfg.IndexPrefix); err != nil {
+		return nil, fmt.Errorf("bootstrap шаблона индекса: %w", err)
+	}
+
+	flushInterval := cfg.FlushInterval
+	if flushInterval == 0 {
+		flushInterval = 5 * time.Second
+	}
+
+	indexer, err := opensearchutil.NewBulkIndexer(opensearchutil.BulkIndexerConfig{
+		Client:        client,
+		NumWorkers:    cfg.NumWorkers,
+		FlushBytes:    cfg.FlushBytes,
+		FlushInterval: flushInterval,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("создание BulkIndexer: %w", err)
+	}
+
+	return &OpenSearchSink{cfg: cfg, client: client, indexer: indexer}, nil
+}
+
+// indexName возвращает имя индекса с суффиксом даты, например "dialogs-2024.01".
+func (s *OpenSearchSink) indexName(t time.Time) string {
+	return fmt.Sprintf("%s-%s", s.cfg.IndexPrefix, t.Format("2006.01"))
+}
+
+// IndexDialog добавляет диалог в очередь BulkIndexer. Фактическая отправка
+// происходит асинхронно пачками по FlushBytes/FlushInterval.
+func (s *OpenSearchSink) IndexDialog(dialog *ProblematicDialog, info *ConversationInfo, chat *ConversationChat) error {
+	now := time.Now()
+
+	doc := dialogDocument{
+		FolderName: dialog.FolderName,
+		DialogID:   dialog.ID,
+		Types:      dialog.Types,
+		Triggers:   dialog.Triggers,
+		Messages:   chat.Messages,
+		IndexedAt:  now,
+	}
+	if info != nil {
+		doc.OperatorName = info.OperatorName
+		doc.OperatorID = info.OperatorID
+		doc.ClientName = info.ClientName
+		doc.ClientID = info.ClientID
+		doc.Date = info.Date
+		doc.Direction = info.Direction
+	}
+
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("сериализация документа для %s: %w", dialog.FolderName, err)
+	}
+
+	return s.indexer.Add(context.Background(), opensearchutil.BulkIndexerItem{
+		Action:     "index",
+		Index:      s.indexName(now),
+		DocumentID: dialog.ID,
+		Body:       bytes.NewReader(body),
+		OnFailure: func(ctx context.Context, item opensearchutil.BulkIndexerItem, res opensearchutil.BulkIndexerResponseItem, err error) {
+			fmt.Printf("Ошибка индексации диалога %s: %v (%s)\n", dialog.FolderName, err, res.Error.Reason)
+		},
+	})
+}
+
+// Close дожидается отправки всех накопленных документов и освобождает ресурсы индексатора.
+func (s *OpenSearchSink) Close() error {
+	return s.indexer.Close(context.Background())
+}
+
+// ensureIndexTemplate создаёт (или обновляет) шаблон индекса, маппящий
+// triggers как массив объектов {text, score, fuzzy} (см. TriggerHit) и
+// messages.text как text с русским анализатором.
+func ensureIndexTemplate(client *opensearch.Client, indexPrefix string) error {
+	template := map[string]interface{}{
+		"index_patterns": []string{indexPrefix + "-*"},
+		"settings": map[string]interface{}{
+			"analysis": map[string]interface{}{
+				"analyzer": map[string]interface{}{
+					"russian_text": map[string]interface{}{
+						"type":      "standard",
+						"stopwords": "_russian_",
+					},
+				},
+			},
+		},
+		"mappings": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"triggers": map[string]interface{}{
+					"properties": map[string]interface{}{
+						"text":  map[string]interface{}{"type": "keyword"},
+						"score": map[string]interface{}{"type": "float"},
+						"fuzzy": map[string]interface{}{"type": "boolean"},
+					},
+				},
+				"types": map[string]interface{}{
+					"type": "keyword",
+				},
+				"messages": map[string]interface{}{
+					"properties": map[string]interface{}{
+						"text": map[string]interface{}{
+							"type":     "text",
+							"analyzer": "russian_text",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	body, err := json.Marshal(template)
+	if err != nil {
+		return err
+	}
+
+	res, err := client.Indices.PutIndexTemplate(
+		indexPrefix+"-template",
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("opensearch вернул ошибку при создании шаблона: %s", res.String())
+	}
+	return nil
+}
+
+// OpenSearchResultSink адаптирует OpenSearchSink под интерфейс ResultSink,
+// которого требует Analyzer.Sinks: перечитывает conv_*_info.json/conv_*_chat.json
+// диалога из InputDir (ProblematicDialog хранит только список имён файлов) и
+// передаёт их вместе с диалогом в IndexDialog. Включается флагом --export-os.
+type OpenSearchResultSink struct {
+	FS       afero.Fs
+	InputDir string
+	sink     *OpenSearchSink
+}
+
+// NewOpenSearchResultSink создаёт ResultSink поверх уже поднятого sink.
+func NewOpenSearchResultSink(fs afero.Fs, inputDir string, sink *OpenSearchSink) *OpenSearchResultSink {
+	return &OpenSearchResultSink{FS: fs, InputDir: inputDir, sink: sink}
+}
+
+func (s *OpenSearchResultSink) Handle(dialog *ProblematicDialog) error {
+	info, chat, err := s.loadDialog(dialog)
+	if err != nil {
+		return fmt.Errorf("чтение диалога %s: %w", dialog.FolderName, err)
+	}
+	return s.sink.IndexDialog(dialog, info, chat)
+}
+
+// loadDialog перечитывает conv_*_info.json и conv_*_chat.json диалога - см.
+// аналогичный метод MboxExportSink.loadDialog.
+func (s *OpenSearchResultSink) loadDialog(dialog *ProblematicDialog) (*ConversationInfo, *ConversationChat, error) {
+	var info ConversationInfo
+	var chat ConversationChat
+
+	for _, file := range dialog.Files {
+		path := filepath.Join(s.InputDir, dialog.FolderName, file)
+
+		switch {
+		case strings.Contains(file, "_info.json"):
+			content, err := afero.ReadFile(s.FS, path)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := json.Unmarshal(content, &info); err != nil {
+				return nil, nil, err
+			}
+		case strings.Contains(file, "_chat.json"):
+			content, err := afero.ReadFile(s.FS, path)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := json.Unmarshal(content, &chat); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return &info, &chat, nil
+}
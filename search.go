@@ -0,0 +1,498 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/afero"
+)
+
+// DialogRecord - проанализированный диалог, восстановленный из корпуса -
+// локального (outputBaseDir/<тип>/<папка>/conv_*_info.json + trigger_info.txt,
+// см. LoadCorpus) или из OpenSearch (см. LoadCorpusFromOpenSearch) - над
+// которым выполняются поисковые запросы.
+type DialogRecord struct {
+	Type      string
+	Folder    string
+	Operator  string
+	Client    string
+	Date      string
+	Direction bool
+	Triggers  []string
+}
+
+// LoadCorpus обходит outputBaseDir и собирает DialogRecord для каждой папки
+// диалога, скопированной туда FolderCopySink.
+func LoadCorpus(fsys afero.Fs, outputBaseDir string) ([]DialogRecord, error) {
+	typeDirs, err := afero.ReadDir(fsys, outputBaseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []DialogRecord
+	for _, typeDir := range typeDirs {
+		if !typeDir.IsDir() {
+			continue
+		}
+		typeKey := typeDir.Name()
+
+		dialogDirs, err := afero.ReadDir(fsys, filepath.Join(outputBaseDir, typeKey))
+		if err != nil {
+			continue
+		}
+
+		for _, dialogDir := range dialogDirs {
+			if !dialogDir.IsDir() {
+				continue
+			}
+			rec, err := loadDialogRecord(fsys, outputBaseDir, typeKey, dialogDir.Name())
+			if err != nil {
+				continue
+			}
+			records = append(records, rec)
+		}
+	}
+
+	return records, nil
+}
+
+func loadDialogRecord(fsys afero.Fs, outputBaseDir, typeKey, folderName string) (DialogRecord, error) {
+	dialogDir := filepath.Join(outputBaseDir, typeKey, folderName)
+	rec := DialogRecord{Type: typeKey, Folder: folderName}
+
+	entries, err := afero.ReadDir(fsys, dialogDir)
+	if err != nil {
+		return rec, err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case strings.Contains(name, "_info.json"):
+			content, err := afero.ReadFile(fsys, filepath.Join(dialogDir, name))
+			if err != nil {
+				continue
+			}
+			var info ConversationInfo
+			if err := json.Unmarshal(content, &info); err != nil {
+				continue
+			}
+			rec.Operator = info.OperatorName
+			rec.Client = info.ClientName
+			rec.Date = info.Date
+			rec.Direction = info.Direction
+		case name == "trigger_info.txt":
+			content, err := afero.ReadFile(fsys, filepath.Join(dialogDir, name))
+			if err != nil {
+				continue
+			}
+			rec.Triggers = parseTriggerInfoTriggers(string(content))
+		}
+	}
+
+	return rec, nil
+}
+
+// LoadCorpusFromOpenSearch забирает проанализированный корпус напрямую из
+// индексов OpenSearch/Elasticsearch (см. OpenSearchSink), по одной записи
+// DialogRecord на пару (диалог, тип проблемы) - для развёртываний, где
+// локальной копии problematicDialogs нет вовсе (только --export-os).
+// openSearchFetchSize - сколько документов запрашивается за один _search.
+// Elasticsearch/OpenSearch по умолчанию отказывает в size больше
+// index.max_result_window (10000), поэтому это одновременно и верхняя граница
+// того, сколько диалогов LoadCorpusFromOpenSearch вообще способна увидеть без
+// постраничного scroll/search_after, который этой функции пока не нужен.
+const openSearchFetchSize = 10000
+
+func LoadCorpusFromOpenSearch(cfg OpenSearchConfig) ([]DialogRecord, error) {
+	client, err := newOpenSearchClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.Search(
+		client.Search.WithIndex(cfg.IndexPrefix+"-*"),
+		client.Search.WithBody(strings.NewReader(`{"query":{"match_all":{}},"track_total_hits":true}`)),
+		client.Search.WithSize(openSearchFetchSize),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("поиск в OpenSearch: %w", err)
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, fmt.Errorf("opensearch вернул ошибку: %s", res.String())
+	}
+
+	var parsed struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+			Hits []struct {
+				Source dialogDocument `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("разбор ответа OpenSearch: %w", err)
+	}
+
+	if parsed.Hits.Total.Value > len(parsed.Hits.Hits) {
+		fmt.Printf("Внимание: в индексах %s-* найдено %d диалогов, но обработаны только первые %d (ограничение size=%d без scroll/search_after)\n",
+			cfg.IndexPrefix, parsed.Hits.Total.Value, len(parsed.Hits.Hits), openSearchFetchSize)
+	}
+
+	var records []DialogRecord
+	for _, hit := range parsed.Hits.Hits {
+		doc := hit.Source
+		triggers := make([]string, 0, len(doc.Triggers))
+		for _, t := range doc.Triggers {
+			triggers = append(triggers, t.Text)
+		}
+		for _, typeKey := range doc.Types {
+			records = append(records, DialogRecord{
+				Type:      typeKey,
+				Folder:    doc.FolderName,
+				Operator:  doc.OperatorName,
+				Client:    doc.ClientName,
+				Date:      doc.Date,
+				Direction: doc.Direction,
+				Triggers:  triggers,
+			})
+		}
+	}
+
+	return records, nil
+}
+
+// triggerLinePattern вытаскивает текст триггера из строки вида
+// "- верните деньги (точное, score=1.00)", которую пишет FolderCopySink.
+var triggerLinePattern = regexp.MustCompile(`^- (.+?) \(`)
+
+func parseTriggerInfoTriggers(content string) []string {
+	var triggers []string
+	for _, line := range strings.Split(content, "\n") {
+		if m := triggerLinePattern.FindStringSubmatch(line); len(m) > 1 {
+			triggers = append(triggers, m[1])
+		}
+	}
+	return triggers
+}
+
+// queryNode - узел AST поискового запроса.
+type queryNode interface {
+	Eval(rec DialogRecord) bool
+}
+
+type andNode struct{ left, right queryNode }
+
+func (n andNode) Eval(rec DialogRecord) bool { return n.left.Eval(rec) && n.right.Eval(rec) }
+
+type orNode struct{ left, right queryNode }
+
+func (n orNode) Eval(rec DialogRecord) bool { return n.left.Eval(rec) || n.right.Eval(rec) }
+
+type notNode struct{ inner queryNode }
+
+func (n notNode) Eval(rec DialogRecord) bool { return !n.inner.Eval(rec) }
+
+// predicateNode проверяет одно поле:значение, например type:refund или
+// trigger:"верните деньги".
+type predicateNode struct {
+	field string
+	value string
+}
+
+func (n predicateNode) Eval(rec DialogRecord) bool {
+	switch n.field {
+	case "type":
+		return strings.EqualFold(rec.Type, n.value)
+	case "trigger":
+		for _, t := range rec.Triggers {
+			if strings.Contains(strings.ToLower(t), strings.ToLower(n.value)) {
+				return true
+			}
+		}
+		return false
+	case "operator":
+		return strings.Contains(strings.ToLower(rec.Operator), strings.ToLower(n.value))
+	case "client":
+		return strings.Contains(strings.ToLower(rec.Client), strings.ToLower(n.value))
+	case "direction":
+		return rec.Direction == strings.EqualFold(n.value, "outgoing")
+	case "date":
+		return evalDateRange(rec.Date, n.value)
+	default:
+		return false
+	}
+}
+
+// evalDateRange поддерживает как точечное/префиксное совпадение (date:2024-01),
+// так и диапазон through "..": date:2024-01..2024-02. Сравнение строковое,
+// поэтому предполагает сортируемый формат даты (ISO-подобный).
+func evalDateRange(date, spec string) bool {
+	if date == "" {
+		return false
+	}
+	from, to, isRange := strings.Cut(spec, "..")
+	if !isRange {
+		return strings.HasPrefix(date, spec)
+	}
+	// "~" выше любой цифры/дефиса в ASCII, поэтому date<=to+"~" включает весь
+	// диапазон, начинающийся с to (например, все дни февраля для to="2024-02").
+	return date >= from && date <= to+"~"
+}
+
+// ParseQuery разбирает notmuch-подобный запрос в AST из AND/OR/NOT над
+// предикатами полей, например:
+// `type:refund and trigger:"вернуть деньги" and operator:"Ivanov" and date:2024-01..2024-02 and direction:outgoing`
+func ParseQuery(query string) (queryNode, error) {
+	p := &queryParser{tokens: tokenizeQuery(query)}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("неожиданный токен %q", p.tokens[p.pos])
+	}
+	return node, nil
+}
+
+type queryParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *queryParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseNot() (queryNode, error) {
+	if strings.EqualFold(p.peek(), "not") {
+		p.next()
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner}, nil
+	}
+	return p.parseAtom()
+}
+
+func (p *queryParser) parseAtom() (queryNode, error) {
+	tok := p.peek()
+	if tok == "" {
+		return nil, fmt.Errorf("пустой запрос")
+	}
+	if tok == "(" {
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("ожидалась закрывающая скобка")
+		}
+		p.next()
+		return inner, nil
+	}
+
+	p.next()
+	field, value, ok := strings.Cut(tok, ":")
+	if !ok {
+		return nil, fmt.Errorf("ожидался предикат вида поле:значение, получено %q", tok)
+	}
+	return predicateNode{field: strings.ToLower(field), value: unquote(value)}, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// tokenizeQuery разбивает запрос на токены по пробелам и скобкам, сохраняя
+// содержимое в кавычках (в т.ч. пробелы) как часть одного токена.
+func tokenizeQuery(query string) []string {
+	var tokens []string
+	var cur strings.Builder
+	inQuotes := false
+
+	flush := func() {
+		if cur.Len() > 0 {
+			tokens = append(tokens, cur.String())
+			cur.Reset()
+		}
+	}
+
+	for _, r := range query {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			cur.WriteRune(r)
+		case unicode.IsSpace(r) && !inQuotes:
+			flush()
+		case (r == '(' || r == ')') && !inQuotes:
+			flush()
+			tokens = append(tokens, string(r))
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	flush()
+
+	return tokens
+}
+
+// loadSearchCorpus выбирает источник корпуса: если в osCfg заданы адреса
+// OpenSearch, записи забираются оттуда (LoadCorpusFromOpenSearch), иначе -
+// из локальной копии problematicDialogs (LoadCorpus).
+func loadSearchCorpus(fsys afero.Fs, outputBaseDir string, osCfg OpenSearchConfig) ([]DialogRecord, error) {
+	if len(osCfg.Addresses) > 0 {
+		records, err := LoadCorpusFromOpenSearch(osCfg)
+		if err != nil {
+			return nil, fmt.Errorf("загрузка корпуса из OpenSearch: %w", err)
+		}
+		return records, nil
+	}
+
+	records, err := LoadCorpus(fsys, outputBaseDir)
+	if err != nil {
+		return nil, fmt.Errorf("загрузка корпуса из %s: %w", outputBaseDir, err)
+	}
+	return records, nil
+}
+
+// runSearchQuery разбирает query, прогоняет его по корпусу (локальному
+// problematicDialogs или OpenSearch - см. loadSearchCorpus) и печатает
+// совпавшие папки с подсвеченным контекстом триггеров в w.
+func runSearchQuery(fsys afero.Fs, outputBaseDir string, osCfg OpenSearchConfig, query string, w io.Writer) error {
+	node, err := ParseQuery(query)
+	if err != nil {
+		return fmt.Errorf("разбор запроса: %w", err)
+	}
+
+	records, err := loadSearchCorpus(fsys, outputBaseDir, osCfg)
+	if err != nil {
+		return err
+	}
+
+	for _, rec := range records {
+		if !node.Eval(rec) {
+			continue
+		}
+		fmt.Fprintf(w, "%s/%s (оператор: %s, клиент: %s, дата: %s)\n", rec.Type, rec.Folder, rec.Operator, rec.Client, rec.Date)
+		for _, trigger := range rec.Triggers {
+			fmt.Fprintf(w, "  >> %s\n", trigger)
+		}
+	}
+
+	return nil
+}
+
+// serveSearchHTTP поднимает GET /search?q=... поверх runSearchQuery, чтобы
+// поверх него можно было построить небольшой веб-UI, не трогая ядро поиска.
+func serveSearchHTTP(addr, outputBaseDir string, osCfg OpenSearchConfig) error {
+	http.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get("q")
+		if q == "" {
+			http.Error(w, "параметр q обязателен", http.StatusBadRequest)
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := runSearchQuery(afero.NewOsFs(), outputBaseDir, osCfg, q, &buf); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+
+	fmt.Printf("HTTP-поиск слушает на %s\n", addr)
+	return http.ListenAndServe(addr, nil)
+}
+
+// runSearchCommand обрабатывает подкоманду
+// `search [--output dir] [--config path] [--http addr] <запрос>`. Если
+// --config указывает на конфигурацию с непустым [opensearch].addresses,
+// корпус для поиска забирается из OpenSearch вместо локального output.
+func runSearchCommand(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	configPath := fs.String("config", "", "Путь к INI конфигурации (для поиска по корпусу в OpenSearch)")
+	outputBaseDir := fs.String("output", "./problematicDialogs", "Директория с проанализированным корпусом")
+	httpAddr := fs.String("http", "", "Поднять HTTP-эндпоинт GET /search?q=... вместо разового запроса")
+	fs.Parse(args)
+
+	var osCfg OpenSearchConfig
+	if *configPath != "" {
+		cfg, err := LoadConfig(*configPath)
+		if err != nil {
+			return fmt.Errorf("чтение конфигурации %s: %w", *configPath, err)
+		}
+		osCfg = cfg.OpenSearch
+	}
+
+	if *httpAddr != "" {
+		return serveSearchHTTP(*httpAddr, *outputBaseDir, osCfg)
+	}
+
+	query := strings.Join(fs.Args(), " ")
+	if query == "" {
+		return fmt.Errorf("использование: search [--output dir] [--config path] <запрос>")
+	}
+
+	return runSearchQuery(afero.NewOsFs(), *outputBaseDir, osCfg, query, os.Stdout)
+}
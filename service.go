@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/kardianos/service"
+)
+
+// dialogService реализует service.Interface поверх Analyzer и служит точкой
+// входа как для интерактивного запуска в режиме демона, так и для запуска
+// под управлением systemd/Windows Service Manager.
+type dialogService struct {
+	analyzer *Analyzer
+	stop     chan struct{}
+	logger   service.Logger
+}
+
+func (d *dialogService) Start(s service.Service) error {
+	d.stop = make(chan struct{})
+	go func() {
+		if err := RunDaemon(d.analyzer, d.stop); err != nil {
+			if d.logger != nil {
+				d.logger.Error(err)
+			} else {
+				fmt.Printf("Ошибка демона: %v\n", err)
+			}
+		}
+	}()
+	return nil
+}
+
+func (d *dialogService) Stop(s service.Service) error {
+	close(d.stop)
+	return nil
+}
+
+// newServiceConfig собирает конфигурацию службы, переиспользуемую и при
+// install/uninstall, и при запуске под service manager.
+func newServiceConfig(inputDir, outputBaseDir string) *service.Config {
+	return &service.Config{
+		Name:        "dialog-analyzer",
+		DisplayName: "Dialog Problem Analyzer",
+		Description: "Следит за папкой с диалогами и раскладывает проблемные по типам",
+		Arguments:   []string{"--daemon", "--input", inputDir, "--output", outputBaseDir},
+	}
+}
+
+// runServiceCommand обрабатывает флаг --service install|start|stop|uninstall,
+// а при запуске без команды (т.е. из-под самого service manager) переходит
+// в режим демона с логированием через service.Logger вместо stdout.
+func runServiceCommand(cmd, inputDir, outputBaseDir string) error {
+	analyzer := NewOSAnalyzer(inputDir, outputBaseDir)
+	prg := &dialogService{analyzer: analyzer}
+
+	svc, err := service.New(prg, newServiceConfig(inputDir, outputBaseDir))
+	if err != nil {
+		return fmt.Errorf("создание службы: %w", err)
+	}
+
+	logger, err := svc.Logger(nil)
+	if err == nil {
+		prg.logger = logger
+	} else {
+		log.SetOutput(os.Stderr)
+	}
+
+	switch cmd {
+	case "install":
+		return svc.Install()
+	case "uninstall":
+		return svc.Uninstall()
+	case "start":
+		return svc.Start()
+	case "stop":
+		return svc.Stop()
+	case "run":
+		return svc.Run()
+	default:
+		return fmt.Errorf("неизвестная команда службы: %s (ожидается install|start|stop|uninstall|run)", cmd)
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ProblemType описывает одну категорию проблемных диалогов: человекочитаемое
+// имя и список триггерных фраз, по которым ищутся совпадения в сообщениях клиента.
+// FuzzyThreshold переопределяет глобальный порог нечёткого поиска для этой
+// категории; 0 означает "использовать порог из [matching]".
+type ProblemType struct {
+	Name           string
+	Triggers       []string
+	FuzzyThreshold float64
+}
+
+// problemTypes - активный набор категорий проблем и их триггеров. Заполняется
+// из конфигурационного файла через Config.Apply и может быть атомарно заменён
+// при SIGHUP reload (см. config.go), не затрагивая уже запущенные горутины анализа.
+var (
+	problemTypes   = make(map[string]ProblemType)
+	problemTypesMu sync.RWMutex
+)
+
+// compiledPattern - предкомпилированное регулярное выражение для одного триггера.
+type compiledPattern struct {
+	trigger string
+	re      *regexp.Regexp
+}
+
+var (
+	compiledPatterns   = make(map[string][]compiledPattern)
+	compiledPatternsMu sync.RWMutex
+)
+
+// fuzzyTriggers и fuzzyTrigramIdx - индексы для нечёткого поиска (см. fuzzy.go):
+// список триггеров-кандидатов на тип проблемы и обратный индекс "триграмма ->
+// индексы триггеров", позволяющий не сравнивать каждый токен текста с каждым
+// триггером.
+var (
+	fuzzyTriggers   = make(map[string][]fuzzyTrigger)
+	fuzzyTrigramIdx = make(map[string]map[string][]int)
+	fuzzyMu         sync.RWMutex
+)
+
+// matchingConfig - активные настройки движка сопоставления из секции
+// [matching], включая глобальный флаг и порог нечёткого поиска.
+var (
+	matchingConfig   = MatchingConfig{WordBoundary: true, FuzzyThreshold: 0.2}
+	matchingConfigMu sync.RWMutex
+)
+
+// SetMatchingConfig атомарно заменяет активные настройки сопоставления.
+// Вызывается при старте и при каждом SIGHUP reload конфигурации.
+func SetMatchingConfig(cfg MatchingConfig) {
+	matchingConfigMu.Lock()
+	matchingConfig = cfg
+	matchingConfigMu.Unlock()
+}
+
+// MatchingCaseSensitive сообщает, нужно ли caller'у (main.go) приводить текст
+// сообщения к нижнему регистру перед FindPatternMatches - то есть активен ли
+// case_sensitive=true из [matching].
+func MatchingCaseSensitive() bool {
+	matchingConfigMu.RLock()
+	defer matchingConfigMu.RUnlock()
+	return matchingConfig.CaseSensitive
+}
+
+// currentProblemTypes возвращает снимок активного набора problemTypes под
+// RLock. По возвращённой карте можно безопасно итерироваться дальше без
+// удержания блокировки: setProblemTypes атомарно подменяет саму переменную
+// problemTypes, а не мутирует карту на месте, так что возвращённый снимок
+// никогда не меняется из-под вызывающей стороны.
+func currentProblemTypes() map[string]ProblemType {
+	problemTypesMu.RLock()
+	defer problemTypesMu.RUnlock()
+	return problemTypes
+}
+
+// initializeProblemTypes - запасной вариант на случай запуска без конфигурационного
+// файла: минимальный набор категорий, достаточный чтобы инструмент не падал.
+func initializeProblemTypes() {
+	setProblemTypes(map[string]ProblemType{
+		"refund": {Name: "Возврат средств", Triggers: []string{"возврат денег", "верните деньги"}},
+		"delay":  {Name: "Задержка доставки", Triggers: []string{"где мой заказ", "долго везете"}},
+	})
+}
+
+// wrapWordBoundary оборачивает уже экранированный (regexp.QuoteMeta) текст
+// триггера границами слова. Go's RE2 `\b` распознаёт только ASCII-символы
+// как "словесные" - для кириллицы (и вообще любого non-ASCII текста, то
+// есть практически всех реальных триггеров этого инструмента) `\b` никогда
+// не совпадает, так что обычный `\b`+pattern+`\b` не находит их вовсе.
+// Поэтому для ASCII-триггеров используется `\b`, а для остальных - ручная
+// Unicode-граница через классы символов (начало строки или не-буква/не-цифра
+// перед триггером и после него).
+func wrapWordBoundary(matchText, quoted string) string {
+	if isASCII(matchText) {
+		return `\b` + quoted + `\b`
+	}
+	const boundary = `[^\p{L}\p{N}_]`
+	return `(?:^|` + boundary + `)` + quoted + `(?:$|` + boundary + `)`
+}
+
+// isASCII сообщает, состоит ли s целиком из ASCII-символов.
+func isASCII(s string) bool {
+	for _, r := range s {
+		if r > unicode.MaxASCII {
+			return false
+		}
+	}
+	return true
+}
+
+// setProblemTypes атомарно заменяет активные категории и перекомпилирует их
+// триггеры в регулярные выражения. Используется и при старте, и при каждом
+// SIGHUP reload конфигурации.
+func setProblemTypes(types map[string]ProblemType) {
+	matchingConfigMu.RLock()
+	defaultThreshold := matchingConfig.FuzzyThreshold
+	caseSensitive := matchingConfig.CaseSensitive
+	wordBoundary := matchingConfig.WordBoundary
+	matchingConfigMu.RUnlock()
+
+	patterns := make(map[string][]compiledPattern, len(types))
+	fuzzyByType := make(map[string][]fuzzyTrigger, len(types))
+	trigramByType := make(map[string]map[string][]int, len(types))
+
+	for typeKey, info := range types {
+		threshold := info.FuzzyThreshold
+		if threshold <= 0 {
+			threshold = defaultThreshold
+		}
+
+		trigramIdx := make(map[string][]int)
+
+		for _, trigger := range info.Triggers {
+			matchText := trigger
+			if !caseSensitive {
+				matchText = strings.ToLower(trigger)
+			}
+
+			patternSrc := regexp.QuoteMeta(matchText)
+			if wordBoundary {
+				patternSrc = wrapWordBoundary(matchText, patternSrc)
+			}
+			patterns[typeKey] = append(patterns[typeKey], compiledPattern{
+				trigger: trigger,
+				re:      regexp.MustCompile(patternSrc),
+			})
+
+			idx := len(fuzzyByType[typeKey])
+			fuzzyByType[typeKey] = append(fuzzyByType[typeKey], fuzzyTrigger{
+				trigger:   matchText,
+				wordCount: len(tokenize(matchText)),
+				threshold: threshold,
+			})
+			for trigram := range trigramsOf(matchText) {
+				trigramIdx[trigram] = append(trigramIdx[trigram], idx)
+			}
+		}
+
+		trigramByType[typeKey] = trigramIdx
+	}
+
+	problemTypesMu.Lock()
+	problemTypes = types
+	problemTypesMu.Unlock()
+
+	compiledPatternsMu.Lock()
+	compiledPatterns = patterns
+	compiledPatternsMu.Unlock()
+
+	fuzzyMu.Lock()
+	fuzzyTriggers = fuzzyByType
+	fuzzyTrigramIdx = trigramByType
+	fuzzyMu.Unlock()
+}
+
+// CleanTriggers убирает дублирующиеся триггеры (без учёта регистра) внутри
+// каждого типа проблем и сортирует их для стабильного порядка проверки.
+func CleanTriggers() {
+	problemTypesMu.Lock()
+	defer problemTypesMu.Unlock()
+
+	for typeKey, info := range problemTypes {
+		seen := make(map[string]bool)
+		cleaned := make([]string, 0, len(info.Triggers))
+		for _, trigger := range info.Triggers {
+			key := strings.ToLower(trigger)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			cleaned = append(cleaned, trigger)
+		}
+		sort.Strings(cleaned)
+		info.Triggers = cleaned
+		problemTypes[typeKey] = info
+	}
+}
+
+// FindPatternMatches возвращает все триггеры типа typeKey, найденные в text
+// (уже приведённом вызывающей стороной к нижнему регистру): точные совпадения
+// по предкомпилированным регулярным выражениям, и, если нечёткий поиск включён
+// в [matching], дополнительно приближённые совпадения с оценкой схожести.
+func FindPatternMatches(text, typeKey string) []TriggerHit {
+	compiledPatternsMu.RLock()
+	patterns := compiledPatterns[typeKey]
+	compiledPatternsMu.RUnlock()
+
+	var hits []TriggerHit
+	exact := make(map[string]bool)
+	for _, p := range patterns {
+		if p.re.MatchString(text) {
+			hits = append(hits, TriggerHit{Text: p.trigger, Score: 1, Fuzzy: false})
+			exact[p.trigger] = true
+		}
+	}
+
+	matchingConfigMu.RLock()
+	fuzzyEnabled := matchingConfig.Fuzzy
+	matchingConfigMu.RUnlock()
+
+	if fuzzyEnabled {
+		for _, hit := range fuzzyMatchType(typeKey, text) {
+			if exact[hit.Text] {
+				continue
+			}
+			hits = append(hits, hit)
+		}
+	}
+
+	return hits
+}